@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,12 +22,23 @@ import (
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/prometheus/exporter-toolkit/web/kingpinflag"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	metricsEndpoint = kingpin.Flag("telemetry.endpoint", "Path under which to expose metrics.").Default("/metrics").String()
-	scrapeURI       = kingpin.Flag("bamboo.uri", "Full Bamboo URI to scrape metrics from.").Default("http://localhost:8085").String()
-	insecure        = kingpin.Flag("insecure", "Ignore server certificate if using https.").Bool()
+	metricsEndpoint  = kingpin.Flag("telemetry.endpoint", "Path under which to expose metrics.").Default("/metrics").String()
+	scrapeURI        = kingpin.Flag("bamboo.uri", "Full Bamboo URI to scrape metrics from.").Default("http://localhost:8085").String()
+	insecure         = kingpin.Flag("insecure", "Ignore server certificate if using https.").Bool()
+	configFile       = kingpin.Flag("config.file", "Path to a YAML file listing multiple Bamboo targets to probe.").String()
+	collectorAgents  = kingpin.Flag("collector.agents", "Enable the agents collector.").Default("true").Bool()
+	collectorQueue   = kingpin.Flag("collector.queue", "Enable the queue collector.").Default("true").Bool()
+	collectorResults = kingpin.Flag("collector.results", "Enable the build results collector.").Default("true").Bool()
+	webConfigFile    = kingpin.Flag("web.config.file", "Path to a YAML file with a username/password for basic auth (used when --bamboo.auth-type=basic).").String()
+	authType         = kingpin.Flag("bamboo.auth-type", "How to authenticate against Bamboo: basic, token, env, or file.").Default("env").Enum("basic", "token", "env", "file")
+	tokenFile        = kingpin.Flag("bamboo.token-file", "Path to a file with a Bamboo personal access token or credentials, used by --bamboo.auth-type=token or file.").String()
+	bambooTimeout    = kingpin.Flag("bamboo.timeout", "Timeout for scraping Bamboo, overridden by the Prometheus scrape timeout header if present.").Default("10s").Duration()
+	resultsStateFile = kingpin.Flag("bamboo.results.state-file", "Path to a file persisting the build results collector's per-plan high watermarks across restarts.").String()
+	resultsMaxAge    = kingpin.Flag("bamboo.results.max-age", "How far into a plan's history to backfill when it has no prior high watermark. 0 means unbounded.").Duration()
 	// toolkitFlags: Add default web server configuration flags.
 	toolkitFlags = kingpinflag.AddFlags(kingpin.CommandLine, ":9117")
 	// gracefulStop: Channel to receive OS signals for graceful shutdown.
@@ -42,9 +58,29 @@ func main() {
 	// listen to termination signals from the OS
 	signal.Notify(gracefulStop, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGQUIT)
 
+	var targets *collector.TargetsConfig
+	if *configFile != "" {
+		var err error
+		targets, err = collector.LoadTargetsConfig(*configFile)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	authenticator, err := buildAuthenticator(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
 	config := &collector.Config{
-		ScrapeURI: *scrapeURI,
-		Insecure:  *insecure,
+		ScrapeURI:         *scrapeURI,
+		Insecure:          *insecure,
+		Authenticator:     authenticator,
+		EnabledCollectors: enabledCollectors(),
+		ResultsStateFile:  *resultsStateFile,
+		ResultsMaxAge:     *resultsMaxAge,
 	}
 
 	exporter := collector.NewExporter(config, logger)
@@ -65,8 +101,35 @@ func main() {
 		os.Exit(0)
 	}()
 
-	// expose metrics endpoint
-	http.Handle(*metricsEndpoint, promhttp.Handler())
+	// expose metrics endpoint, instrumented so operators can alert on the
+	// exporter's own HTTP handler (duration, in-flight, response size).
+	metricsHandlerDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bamboo_exporter_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests handled by the exporter itself, by handler and code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler", "code"})
+	metricsHandlerInFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "bamboo_exporter_http_requests_in_flight",
+		Help: "Number of HTTP requests currently being served by the exporter.",
+	})
+	prometheus.MustRegister(metricsHandlerDuration, metricsHandlerInFlight)
+
+	instrumentedMetricsHandler := promhttp.InstrumentHandlerInFlight(metricsHandlerInFlight,
+		promhttp.InstrumentHandlerDuration(metricsHandlerDuration.MustCurryWith(prometheus.Labels{"handler": "metrics"}),
+			promhttp.Handler(),
+		),
+	)
+	http.Handle(*metricsEndpoint, withScrapeContext(exporter, instrumentedMetricsHandler))
+
+	// expose the multi-target probe endpoint, e.g. /probe?target=https://bamboo.example.com
+	probeHTTPHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, logger, targets, authenticator)
+	})
+	http.Handle("/probe", promhttp.InstrumentHandlerInFlight(metricsHandlerInFlight,
+		promhttp.InstrumentHandlerDuration(metricsHandlerDuration.MustCurryWith(prometheus.Labels{"handler": "probe"}),
+			probeHTTPHandler,
+		),
+	))
 
 	// configure the landing page
 	landingConfig := web.LandingConfig{
@@ -78,6 +141,10 @@ func main() {
 				Address: *metricsEndpoint,
 				Text:    "Metrics",
 			},
+			{
+				Address: "/probe?target=" + *scrapeURI,
+				Text:    "Probe",
+			},
 		},
 	}
 
@@ -95,3 +162,121 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// withScrapeContext derives a context from the incoming scrape request -
+// honoring Prometheus's X-Prometheus-Scrape-Timeout-Seconds header, falling
+// back to --bamboo.timeout - and holds exporter locked to that context for
+// the whole request, so a stuck Bamboo instance can't hold a scrape open
+// indefinitely, and so overlapping /metrics requests can't race each other's
+// contexts (see Exporter.BeginScrape).
+func withScrapeContext(exporter *collector.Exporter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := scrapeContext(r)
+		defer cancel()
+		end := exporter.BeginScrape(ctx)
+		defer end()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// scrapeContext derives the scrape deadline from r, as described above.
+func scrapeContext(r *http.Request) (context.Context, context.CancelFunc) {
+	timeout := *bambooTimeout
+	if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	if timeout <= 0 {
+		return context.WithCancel(r.Context())
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// enabledCollectors builds the collector enable/disable set from the
+// --collector.* flags, following node_exporter's --collector.x / --no-collector.x
+// convention.
+func enabledCollectors() map[string]bool {
+	return map[string]bool{
+		"agents":  *collectorAgents,
+		"queue":   *collectorQueue,
+		"results": *collectorResults,
+	}
+}
+
+// probeHandler builds a short-lived Exporter for the target given in the
+// "target" query parameter and serves its metrics from a fresh registry, so
+// that one exporter process can monitor many Bamboo servers.
+func probeHandler(w http.ResponseWriter, r *http.Request, logger *slog.Logger, targets *collector.TargetsConfig, defaultAuth collector.Authenticator) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	config := &collector.Config{
+		ScrapeURI:         target,
+		Insecure:          *insecure,
+		Authenticator:     defaultAuth,
+		EnabledCollectors: enabledCollectors(),
+		// No ResultsStateFile: probed targets are scraped ad hoc and don't
+		// share plan names, so there's no single high-watermark file that
+		// would be safe to reuse across them.
+		ResultsMaxAge: *resultsMaxAge,
+	}
+	if targets != nil {
+		if t, ok := targets.Lookup(target); ok {
+			config.Insecure = t.Insecure
+			if auth := t.Authenticator(); auth != nil {
+				config.Authenticator = auth
+			}
+		}
+	}
+
+	probeExporter := collector.NewExporter(config, logger)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeExporter)
+
+	withScrapeContext(probeExporter, promhttp.HandlerFor(registry, promhttp.HandlerOpts{})).ServeHTTP(w, r)
+}
+
+// buildAuthenticator constructs the Authenticator described by --bamboo.auth-type.
+func buildAuthenticator(logger *slog.Logger) (collector.Authenticator, error) {
+	switch *authType {
+	case "basic":
+		if *webConfigFile == "" {
+			return nil, fmt.Errorf("--bamboo.auth-type=basic requires --web.config.file")
+		}
+		data, err := os.ReadFile(*webConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading web config file: %w", err)
+		}
+		var creds struct {
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+		}
+		if err := yaml.Unmarshal(data, &creds); err != nil {
+			return nil, fmt.Errorf("error unmarshaling web config file: %w", err)
+		}
+		return &collector.BasicAuthenticator{Username: creds.Username, Password: creds.Password}, nil
+
+	case "token":
+		if *tokenFile == "" {
+			return nil, fmt.Errorf("--bamboo.auth-type=token requires --bamboo.token-file")
+		}
+		data, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading token file: %w", err)
+		}
+		return &collector.TokenAuthenticator{Token: strings.TrimSpace(string(data))}, nil
+
+	case "file":
+		if *tokenFile == "" {
+			return nil, fmt.Errorf("--bamboo.auth-type=file requires --bamboo.token-file")
+		}
+		return collector.NewFileAuthenticator(*tokenFile, logger)
+
+	default:
+		return &collector.EnvAuthenticator{}, nil
+	}
+}
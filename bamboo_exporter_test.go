@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScrapeContextTimeout(t *testing.T) {
+	original := *bambooTimeout
+	*bambooTimeout = 10 * time.Second
+	defer func() { *bambooTimeout = original }()
+
+	cases := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "no header falls back to default", header: "", want: 10 * time.Second},
+		{name: "valid header overrides default", header: "5", want: 5 * time.Second},
+		{name: "fractional seconds", header: "1.5", want: 1500 * time.Millisecond},
+		{name: "invalid header falls back to default", header: "not-a-number", want: 10 * time.Second},
+		{name: "zero header falls back to default", header: "0", want: 10 * time.Second},
+		{name: "negative header falls back to default", header: "-1", want: 10 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.header != "" {
+				req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tc.header)
+			}
+
+			ctx, cancel := scrapeContext(req)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatalf("expected a deadline, got none")
+			}
+			if got := time.Until(deadline); got <= 0 || got > tc.want {
+				t.Fatalf("deadline %v from now, want <= %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestScrapeContextNoTimeout(t *testing.T) {
+	original := *bambooTimeout
+	*bambooTimeout = 0
+	defer func() { *bambooTimeout = original }()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	ctx, cancel := scrapeContext(req)
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("expected no deadline when --bamboo.timeout is 0 and no header is set")
+	}
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("expected context to still be live, got err: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BambooAgent represents an agent's data fetched from the Bamboo API.
+type BambooAgent struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	IsActive bool   `json:"active"`
+	IsBusy   bool   `json:"busy"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// agentsCollector scrapes /rest/api/latest/agent and exposes agent status
+// and utilization metrics.
+type agentsCollector struct {
+	agents      *prometheus.GaugeVec
+	utilization prometheus.Gauge
+}
+
+func newAgentsCollector() *agentsCollector {
+	return &agentsCollector{
+		agents: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "agents_status",
+			Help:      "Status of Bamboo agents (enabled/active/busy).",
+		}, []string{"id", "name", "type", "enabled", "active", "busy"}),
+		utilization: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "agent_utilization",
+			Help:      "Utilization rate of Bamboo agents (busy/active ratio).",
+		}),
+	}
+}
+
+func (c *agentsCollector) Name() string { return "agents" }
+
+func (c *agentsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.agents.Describe(ch)
+	c.utilization.Describe(ch)
+}
+
+func (c *agentsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.agents.Collect(ch)
+	c.utilization.Collect(ch)
+}
+
+// Scrape fetches and processes agent metrics from Bamboo.
+func (c *agentsCollector) Scrape(ctx context.Context, client *bambooClient) error {
+	data, err := client.Get(ctx, "/rest/api/latest/agent")
+	if err != nil {
+		return fmt.Errorf("error fetching agents: %w", err)
+	}
+
+	var agents []BambooAgent
+	if err := json.Unmarshal(data, &agents); err != nil {
+		return fmt.Errorf("error unmarshaling agents: %w", err)
+	}
+
+	c.agents.Reset()
+	activeCount := 0
+	busyCount := 0
+
+	for _, agent := range agents {
+		if agent.IsActive {
+			activeCount++
+		}
+
+		if agent.IsBusy {
+			busyCount++
+		}
+		c.agents.WithLabelValues(strconv.FormatInt(agent.ID, 10), agent.Name, agent.Type,
+			fmt.Sprintf("%t", agent.Enabled), fmt.Sprintf("%t", agent.IsActive),
+			fmt.Sprintf("%t", agent.IsBusy)).Set(1)
+	}
+
+	if activeCount > 0 {
+		utilization := float64(busyCount) / float64(activeCount)
+		c.utilization.Set(utilization)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"log/slog"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Authenticator supplies credentials for requests to the Bamboo API. It is
+// consulted on every request, so implementations backed by disk should
+// cache and refresh internally rather than doing I/O per call.
+type Authenticator interface {
+	// Authenticate sets whatever auth header(s) req needs before it is sent.
+	Authenticate(req *http.Request) error
+}
+
+// BasicAuthenticator authenticates with a fixed HTTP basic auth username and
+// password, such as one loaded once from a web-config-style YAML file at
+// startup.
+type BasicAuthenticator struct {
+	Username string
+	Password string
+}
+
+// Authenticate implements Authenticator.
+func (a *BasicAuthenticator) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// TokenAuthenticator authenticates with a Bamboo personal access token,
+// sent as an Authorization: Bearer header.
+type TokenAuthenticator struct {
+	Token string
+}
+
+// Authenticate implements Authenticator.
+func (a *TokenAuthenticator) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// EnvAuthenticator reads credentials from the environment on every request:
+// BAMBOO_TOKEN if set, otherwise BAMBOO_USERNAME/BAMBOO_PASSWORD.
+type EnvAuthenticator struct{}
+
+// Authenticate implements Authenticator.
+func (a *EnvAuthenticator) Authenticate(req *http.Request) error {
+	if token := os.Getenv("BAMBOO_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+
+	username := os.Getenv("BAMBOO_USERNAME")
+	if username == "" {
+		return errors.New("none of BAMBOO_TOKEN or BAMBOO_USERNAME/BAMBOO_PASSWORD are set")
+	}
+	req.SetBasicAuth(username, os.Getenv("BAMBOO_PASSWORD"))
+	return nil
+}
+
+// fileCredentials is the schema of the hot-reloaded credential file read by
+// FileAuthenticator (--bamboo.auth-type=file with --bamboo.token-file).
+type fileCredentials struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+}
+
+// FileAuthenticator authenticates from a YAML credential file, reloading it
+// whenever the file changes on disk so that credentials can be rotated
+// without restarting the exporter.
+type FileAuthenticator struct {
+	path   string
+	logger *slog.Logger
+
+	mu    sync.RWMutex
+	creds fileCredentials
+}
+
+// NewFileAuthenticator loads path once and starts watching it for changes.
+func NewFileAuthenticator(path string, logger *slog.Logger) (*FileAuthenticator, error) {
+	a := &FileAuthenticator{path: filepath.Clean(path), logger: logger}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating credential file watcher: %w", err)
+	}
+	// Watch the containing directory rather than the file itself: editors and
+	// "mv" replace it by renaming a new file into place, which drops the
+	// watch on the old inode, and Kubernetes mounts a secret as a symlink
+	// through a "..data" directory that it swaps atomically on rotation -
+	// neither fires a Write/Create event on path itself, only on its
+	// directory. Mirrors exporter-toolkit's config reloader.
+	if err := watcher.Add(filepath.Dir(a.path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("error watching credential file directory: %w", err)
+	}
+	go a.watch(watcher)
+
+	return a, nil
+}
+
+func (a *FileAuthenticator) reload() error {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("error reading credential file: %w", err)
+	}
+
+	var creds fileCredentials
+	if err := yaml.Unmarshal(data, &creds); err != nil {
+		return fmt.Errorf("error unmarshaling credential file: %w", err)
+	}
+
+	a.mu.Lock()
+	a.creds = creds
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *FileAuthenticator) watch(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			// The directory watch fires for every entry in it, including a
+			// Kubernetes secret's "..data" symlink swap, which is what
+			// actually changes which file our path resolves to. Reload on
+			// either that or our own path to avoid missing a rotation, at
+			// the cost of the occasional no-op reload for an unrelated file.
+			if filepath.Clean(event.Name) != a.path && filepath.Base(event.Name) != "..data" {
+				continue
+			}
+			if err := a.reload(); err != nil {
+				a.logger.Error("Failed to reload credential file", "path", a.path, "error", err)
+			} else {
+				a.logger.Info("Reloaded credential file", "path", a.path)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			a.logger.Error("Credential file watcher error", "path", a.path, "error", err)
+		}
+	}
+}
+
+// Authenticate implements Authenticator.
+func (a *FileAuthenticator) Authenticate(req *http.Request) error {
+	a.mu.RLock()
+	creds := a.creds
+	a.mu.RUnlock()
+
+	if creds.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.Token)
+		return nil
+	}
+	if creds.Username == "" {
+		return fmt.Errorf("no credentials loaded from %s", a.path)
+	}
+	req.SetBasicAuth(creds.Username, creds.Password)
+	return nil
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBasicAuthenticator(t *testing.T) {
+	a := &BasicAuthenticator{Username: "alice", Password: "hunter2"}
+	req := httptestRequest(t)
+
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	username, password, ok := req.BasicAuth()
+	if !ok || username != "alice" || password != "hunter2" {
+		t.Fatalf("BasicAuth() = (%q, %q, %v), want (alice, hunter2, true)", username, password, ok)
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := &TokenAuthenticator{Token: "abc123"}
+	req := httptestRequest(t)
+
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	if got, want := req.Header.Get("Authorization"), "Bearer abc123"; got != want {
+		t.Fatalf("Authorization header = %q, want %q", got, want)
+	}
+}
+
+func TestEnvAuthenticatorPrefersToken(t *testing.T) {
+	t.Setenv("BAMBOO_TOKEN", "tok")
+	t.Setenv("BAMBOO_USERNAME", "alice")
+	t.Setenv("BAMBOO_PASSWORD", "hunter2")
+
+	a := &EnvAuthenticator{}
+	req := httptestRequest(t)
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got, want := req.Header.Get("Authorization"), "Bearer tok"; got != want {
+		t.Fatalf("Authorization header = %q, want %q", got, want)
+	}
+}
+
+func TestEnvAuthenticatorFallsBackToBasic(t *testing.T) {
+	t.Setenv("BAMBOO_TOKEN", "")
+	t.Setenv("BAMBOO_USERNAME", "alice")
+	t.Setenv("BAMBOO_PASSWORD", "hunter2")
+
+	a := &EnvAuthenticator{}
+	req := httptestRequest(t)
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	username, password, ok := req.BasicAuth()
+	if !ok || username != "alice" || password != "hunter2" {
+		t.Fatalf("BasicAuth() = (%q, %q, %v), want (alice, hunter2, true)", username, password, ok)
+	}
+}
+
+func TestEnvAuthenticatorErrorsWithNoCredentials(t *testing.T) {
+	t.Setenv("BAMBOO_TOKEN", "")
+	t.Setenv("BAMBOO_USERNAME", "")
+	t.Setenv("BAMBOO_PASSWORD", "")
+
+	a := &EnvAuthenticator{}
+	if err := a.Authenticate(httptestRequest(t)); err == nil {
+		t.Fatalf("expected an error with no BAMBOO_* environment variables set")
+	}
+}
+
+func TestFileAuthenticatorReloadsOnRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "creds.yaml")
+	writeFile(t, path, "token: first\n")
+
+	a, err := NewFileAuthenticator(path, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("NewFileAuthenticator: %v", err)
+	}
+
+	assertToken(t, a, "first")
+
+	// Simulate an editor/"mv" rotating the file in by renaming a new file
+	// into place, rather than writing to the existing inode in place.
+	replacement := filepath.Join(dir, "creds.yaml.new")
+	writeFile(t, replacement, "token: second\n")
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	waitForToken(t, a, "second")
+}
+
+func httptestRequest(t *testing.T) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://example.invalid/rest/api/latest/agent", nil)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	return req
+}
+
+func writeFile(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+func assertToken(t *testing.T, a *FileAuthenticator, want string) {
+	t.Helper()
+	req := httptestRequest(t)
+	if err := a.Authenticate(req); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer "+want {
+		t.Fatalf("Authorization header = %q, want %q", got, "Bearer "+want)
+	}
+}
+
+// waitForToken polls Authenticate until it reflects want or the deadline
+// passes, since the reload happens asynchronously off an fsnotify event.
+func waitForToken(t *testing.T, a *FileAuthenticator, want string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		req := httptestRequest(t)
+		if err := a.Authenticate(req); err == nil && req.Header.Get("Authorization") == "Bearer "+want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("credential file rotation was not picked up within the deadline")
+}
@@ -0,0 +1,51 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// bambooClient performs authenticated HTTP calls against a single Bamboo
+// instance on behalf of the registered sub-collectors.
+type bambooClient struct {
+	uri          string
+	auth         Authenticator
+	http         *http.Client
+	responseSize prometheus.Histogram
+}
+
+// Get sends a GET request to the Bamboo API and returns the response body.
+func (c *bambooClient) Get(ctx context.Context, endpoint string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.uri+endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if err := c.auth.Authenticate(req); err != nil {
+		return nil, fmt.Errorf("error authenticating request: %w", err)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error performing request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status code: " + resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.responseSize.Observe(float64(len(body)))
+
+	return body, nil
+}
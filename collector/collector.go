@@ -1,75 +1,129 @@
 package collector
 
 import (
+	"context"
 	"crypto/tls"
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"os"
-	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	"log/slog"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const namespace = "bamboo"
 
-// Exporter collects metrics from Bamboo and exposes them to Prometheus.
+// Collector is implemented by each Bamboo sub-collector (agents, queue,
+// build results, and future ones such as deployments or plans) so that
+// Exporter can run them as a pluggable, independently enable-able registry.
+type Collector interface {
+	// Name identifies the collector for its --collector.<name> flag and for
+	// the collector label on the self-observability metrics.
+	Name() string
+	Describe(ch chan<- *prometheus.Desc)
+	Collect(ch chan<- prometheus.Metric)
+	Scrape(ctx context.Context, client *bambooClient) error
+}
+
+// Exporter collects metrics from Bamboo and exposes them to Prometheus. It
+// holds no Bamboo-specific scraping logic itself: that lives in the
+// individual Collectors it runs.
 type Exporter struct {
-	URI               string
-	client            *http.Client
-	mutex             sync.Mutex
-	up                *prometheus.Desc
-	failures          prometheus.Counter
-	agents            *prometheus.GaugeVec
-	queue             prometheus.Gauge
-	utilization       prometheus.Gauge
-	queueChange       prometheus.Gauge
-	logger            *slog.Logger
-	previousQueueSize int64
-	buildSuccess      *prometheus.CounterVec
-	buildFailure      *prometheus.CounterVec
-	buildCount        *prometheus.GaugeVec
+	client     *bambooClient
+	mutex      sync.Mutex
+	up         *prometheus.Desc
+	failures   prometheus.Counter
+	logger     *slog.Logger
+	collectors []Collector
+
+	// ctx is the context.Context for the in-flight scrape. It is only ever
+	// read or written while mutex is held, by BeginScrape and by Collect, so
+	// that one /metrics request's context can never leak into a different,
+	// overlapping request's scrape - see BeginScrape.
+	ctx context.Context
+
+	// self-observability metrics for this exporter instance
+	scrapeDuration     *prometheus.HistogramVec
+	scrapeSuccess      *prometheus.GaugeVec
+	clientInFlight     prometheus.Gauge
+	clientRequests     *prometheus.CounterVec
+	clientDuration     *prometheus.HistogramVec
+	clientResponseSize prometheus.Histogram
 }
 
-// Config holds the configuration for the exporter.
+// Config holds the per-target configuration for an Exporter. A new Exporter
+// (and Config) is built for every /probe request, so none of these fields are
+// process-global.
 type Config struct {
 	ScrapeURI string
 	Insecure  bool
-}
 
-// BambooAgent represents an agent's data fetched from the Bamboo API.
-type BambooAgent struct {
-	ID       int64  `json:"id"`
-	Name     string `json:"name"`
-	Type     string `json:"type"`
-	IsActive bool   `json:"active"`
-	IsBusy   bool   `json:"busy"`
-	Enabled  bool   `json:"enabled"`
+	// Authenticator supplies credentials for every request made against
+	// ScrapeURI. Callers build it from --bamboo.auth-type (or per-target
+	// credentials from a multi-target config file).
+	Authenticator Authenticator
+
+	// EnabledCollectors lists the sub-collectors to run, by Name(). A nil or
+	// empty map runs none; NewExporter callers should default it from the
+	// --collector.* flags.
+	EnabledCollectors map[string]bool
+
+	// ResultsStateFile, if set, persists the results collector's per-plan
+	// high watermarks across restarts. See --bamboo.results.state-file.
+	ResultsStateFile string
+	// ResultsMaxAge bounds how far into a plan's history the results
+	// collector will backfill when it has no prior high watermark for that
+	// plan. Zero means unbounded. See --bamboo.results.max-age.
+	ResultsMaxAge time.Duration
 }
 
-// BambooQueue represents the build queue data fetched from the Bamboo API.
-type BambooQueue struct {
-	QueuedBuilds struct {
-		Size int64 `json:"size"`
-	} `json:"queuedBuilds"`
-}
-
-// NewExporter creates a new instance of Exporter.
+// NewExporter creates a new Exporter scoped to a single Bamboo instance. It is
+// cheap enough to call once per scrape, which is what the /probe handler does
+// to support monitoring many Bamboo servers from one exporter process.
 func NewExporter(config *Config, logger *slog.Logger) *Exporter {
-	return &Exporter{
-		URI: config.ScrapeURI,
-		client: &http.Client{
-			Transport: &http.Transport{
+	clientInFlight := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "client_in_flight_requests",
+		Help:      "Number of in-flight requests to the Bamboo API.",
+	})
+	clientRequests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "client_requests_total",
+		Help:      "Total requests made to the Bamboo API, by status code.",
+	}, []string{"code", "method"})
+	clientDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "client_request_duration_seconds",
+		Help:      "Duration of requests to the Bamboo API, by status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"code", "method"})
+	clientResponseSize := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "client_response_size_bytes",
+		Help:      "Size of responses received from the Bamboo API.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8),
+	})
+
+	transport := promhttp.InstrumentRoundTripperInFlight(clientInFlight,
+		promhttp.InstrumentRoundTripperCounter(clientRequests,
+			promhttp.InstrumentRoundTripperDuration(clientDuration, &http.Transport{
 				TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
-			},
-		},
+			}),
+		),
+	)
+
+	client := &bambooClient{
+		uri:          config.ScrapeURI,
+		auth:         config.Authenticator,
+		http:         &http.Client{Transport: transport},
+		responseSize: clientResponseSize,
+	}
+
+	e := &Exporter{
+		client:     client,
+		collectors: buildCollectors(config.EnabledCollectors, config, logger),
 		up: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "up"),
 			"Whether the Bamboo API is reachable.",
@@ -81,267 +135,130 @@ func NewExporter(config *Config, logger *slog.Logger) *Exporter {
 			Name:      "scrape_failures_total",
 			Help:      "Total number of scrape failures.",
 		}),
-		agents: prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "agents_status",
-			Help:      "Status of Bamboo agents (enabled/active/busy).",
-		}, []string{"id", "name", "type", "enabled", "active", "busy"}),
-		queue: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "queue_size",
-			Help:      "Number of builds in the Bamboo queue.",
-		}),
-		utilization: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "agent_utilization",
-			Help:      "Utilization rate of Bamboo agents (busy/active ratio).",
-		}),
-		queueChange: prometheus.NewGauge(prometheus.GaugeOpts{
-			Namespace: namespace,
-			Name:      "queue_change",
-			Help:      "Change in the Bamboo build queue size since the last scrape.",
-		}),
-		buildSuccess: prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: namespace,
-			Name:      "build_success_total",
-			Help:      "Successful builds per project version",
-		}, []string{"project", "name"}),
-		buildFailure: prometheus.NewCounterVec(prometheus.CounterOpts{
+		scrapeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: namespace,
-			Name:      "build_failure_total",
-			Help:      "Failed builds per project version",
-		}, []string{"project", "name"}),
-		buildCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:      "scrape_duration_seconds",
+			Help:      "Duration of a scrape of a single sub-collector.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"collector"}),
+		scrapeSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Namespace: namespace,
-			Name:      "build_total",
-			Help:      "Total builds executed per project version",
-		}, []string{"project", "name"}),
-		logger: logger,
+			Name:      "scrape_collector_success",
+			Help:      "Whether the last scrape of a sub-collector succeeded.",
+		}, []string{"collector"}),
+		clientInFlight:     clientInFlight,
+		clientRequests:     clientRequests,
+		clientDuration:     clientDuration,
+		clientResponseSize: clientResponseSize,
+		logger:             logger,
+		ctx:                context.Background(),
 	}
+	return e
 }
 
-// Describe describes the Prometheus metrics for the exporter.
-func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
-	ch <- e.up
-	e.failures.Describe(ch)
-	e.agents.Describe(ch)
-	e.queue.Describe(ch)
-	e.utilization.Describe(ch)
-	e.queueChange.Describe(ch)
-	e.buildSuccess.Describe(ch)
-	e.buildFailure.Describe(ch)
-	e.buildCount.Describe(ch)
-}
-
-// Collect collects metrics from Bamboo and sends them to Prometheus.
-func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+// BeginScrape locks the exporter for the scrape that ctx belongs to and
+// records ctx as the one Collect should use, returning a function that
+// unlocks it once the scrape (and the HTTP response it produced) is
+// complete. Callers must hold the lock for the whole request, not just the
+// Collect call: /metrics can receive overlapping requests, and holding the
+// lock only around Collect would let one request's context overwrite
+// another's before it's read, or get canceled while the other is still
+// using it.
+func (e *Exporter) BeginScrape(ctx context.Context) func() {
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
-
-	success := e.scrapeMetrics()
-	ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, success)
-	e.failures.Collect(ch)
-	e.agents.Collect(ch)
-	e.queue.Collect(ch)
-	e.utilization.Collect(ch)
-	e.queueChange.Collect(ch)
-	e.buildSuccess.Collect(ch)
-	e.buildFailure.Collect(ch)
-	e.buildCount.Collect(ch)
-}
-
-// scrapeMetrics fetches metrics from Bamboo and processes them.
-func (e *Exporter) scrapeMetrics() float64 {
-	if err := e.scrapeAgents(); err != nil {
-		e.logger.Error("Failed to scrape agents", "error", err)
-		e.failures.Inc()
-		return 0
-	}
-
-	if err := e.scrapeQueue(); err != nil {
-		e.logger.Error("Failed to scrape queue", "error", err)
-		e.failures.Inc()
-		return 0
-	}
-
-	if err := e.scrapeBuildResults(); err != nil {
-		e.logger.Error("Failed to scrape build results", "error", err)
-		e.failures.Inc()
-		return 0
-	}
-
-	return 1
+	e.ctx = ctx
+	return e.mutex.Unlock
 }
 
-// scrapeAgents fetches and processes agent metrics from Bamboo.
-func (e *Exporter) scrapeAgents() error {
-	data, err := e.doRequest("/rest/api/latest/agent")
-	if err != nil {
-		return fmt.Errorf("error fetching agents: %w", err)
+// buildCollectors constructs the set of sub-collectors named in enabled. A
+// collector whose name is missing or false is left out of the registry
+// entirely, so it never makes a request against Bamboo.
+func buildCollectors(enabled map[string]bool, config *Config, logger *slog.Logger) []Collector {
+	all := []Collector{
+		newAgentsCollector(),
+		newQueueCollector(),
+		newResultsCollector(config.ResultsStateFile, config.ResultsMaxAge, logger),
 	}
 
-	var agents []BambooAgent
-	if err := json.Unmarshal(data, &agents); err != nil {
-		return fmt.Errorf("error unmarshaling agents: %w", err)
-	}
-
-	e.agents.Reset()
-	activeCount := 0
-	busyCount := 0
-
-	for _, agent := range agents {
-		if agent.IsActive {
-			activeCount++
+	var active []Collector
+	for _, c := range all {
+		if enabled[c.Name()] {
+			active = append(active, c)
 		}
-
-		if agent.IsBusy {
-			busyCount++
-		}
-		e.agents.WithLabelValues(strconv.FormatInt(agent.ID, 10), agent.Name, agent.Type,
-			fmt.Sprintf("%t", agent.Enabled), fmt.Sprintf("%t", agent.IsActive),
-			fmt.Sprintf("%t", agent.IsBusy)).Set(1)
-	}
-
-	if activeCount > 0 {
-		utilization := float64(busyCount) / float64(activeCount)
-		e.utilization.Set(utilization)
 	}
-
-	return nil
+	return active
 }
 
-// scrapeQueue fetches and processes queue metrics from Bamboo.
-func (e *Exporter) scrapeQueue() error {
-	data, err := e.doRequest("/rest/api/latest/queue")
-	if err != nil {
-		return fmt.Errorf("error fetching queue: %w", err)
-	}
-
-	var queue BambooQueue
-	if err := json.Unmarshal(data, &queue); err != nil {
-		return fmt.Errorf("error unmarshaling queue: %w", err)
+// Describe describes the Prometheus metrics for the exporter.
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.up
+	e.failures.Describe(ch)
+	e.scrapeDuration.Describe(ch)
+	e.scrapeSuccess.Describe(ch)
+	e.clientInFlight.Describe(ch)
+	e.clientRequests.Describe(ch)
+	e.clientDuration.Describe(ch)
+	e.clientResponseSize.Describe(ch)
+	for _, c := range e.collectors {
+		c.Describe(ch)
 	}
-
-	currentQueueSize := queue.QueuedBuilds.Size
-	e.queue.Set(float64(currentQueueSize))
-
-	// Calculate queue size change
-	change := currentQueueSize - e.previousQueueSize
-	e.queueChange.Set(float64(change))
-	e.previousQueueSize = currentQueueSize
-
-	return nil
 }
 
-// scrapeBuildResults fetches and processes build results from Bamboo.
-func (e *Exporter) scrapeBuildResults() error {
-	currentIndex := 0
-	totalSize := 0
-	maxResult := 100
-
-	for {
-		params := url.Values{
-			"start-index": []string{strconv.Itoa(currentIndex)},
-			"max-result":  []string{strconv.Itoa(maxResult)},
-			"expand":      []string{"results.result"},
-		}
-
-		data, err := e.doRequest("/rest/api/latest/result?" + params.Encode())
-		if err != nil {
-			return fmt.Errorf("error fetching result: %w", err)
-		}
-
-		var response struct {
-			Results struct {
-				Size   int `json:"size"`
-				Result []struct {
-					Plan struct {
-						Name string `json:"name"`
-					} `json:"plan"`
-					BuildNumber int    `json:"buildNumber"`
-					State       string `json:"state"`
-				} `json:"result"`
-			} `json:"results"`
-		}
-
-		if err := json.Unmarshal(data, &response); err != nil {
-			return fmt.Errorf("error unmarshaling results: %w", err)
-		}
-
-		if totalSize == 0 {
-			totalSize = response.Results.Size
-		}
-
-		// process data of current page
-		for _, r := range response.Results.Result {
-			project, name := parseProjectAndName(r.Plan.Name)
-			labels := []string{project, name}
-
-			switch r.State {
-			case "Successful":
-				e.buildSuccess.WithLabelValues(labels...).Inc()
-			default:
-				e.buildFailure.WithLabelValues(labels...).Inc()
-			}
-
-			// set build count
-			e.buildCount.WithLabelValues(labels...).Set(float64(r.BuildNumber))
-		}
+// Collect runs every enabled sub-collector concurrently and sends their
+// metrics, along with the exporter's own self-observability metrics, to
+// Prometheus. Callers must hold the exporter locked via BeginScrape for the
+// duration of the call, so that e.ctx is the context for this scrape and
+// not one from an overlapping request.
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	ctx := e.ctx
+
+	var wg sync.WaitGroup
+	succeeded := make([]bool, len(e.collectors))
+	for i, c := range e.collectors {
+		wg.Add(1)
+		go func(i int, c Collector) {
+			defer wg.Done()
+			succeeded[i] = e.scrapeCollector(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
 
-		// end of page
-		fetchedCount := currentIndex + len(response.Results.Result)
-		if fetchedCount >= totalSize || len(response.Results.Result) == 0 {
+	up := 1.0
+	for _, ok := range succeeded {
+		if !ok {
+			up = 0
 			break
 		}
-		currentIndex = fetchedCount
 	}
-	return nil
-}
+	ch <- prometheus.MustNewConstMetric(e.up, prometheus.GaugeValue, up)
 
-// doRequest sends a GET request to the Bamboo API and returns the response body.
-func (e *Exporter) doRequest(endpoint string) ([]byte, error) {
-	configData, err := os.ReadFile("config.json")
-	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
-	}
-
-	var config struct {
-		BambooUsername string `json:"bamboo_username"`
-		BambooPassword string `json:"bamboo_password"`
-	}
-	err = json.Unmarshal(configData, &config)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshaling config file: %w", err)
+	e.failures.Collect(ch)
+	e.scrapeDuration.Collect(ch)
+	e.scrapeSuccess.Collect(ch)
+	e.clientInFlight.Collect(ch)
+	e.clientRequests.Collect(ch)
+	e.clientDuration.Collect(ch)
+	e.clientResponseSize.Collect(ch)
+	for _, c := range e.collectors {
+		c.Collect(ch)
 	}
+}
 
-	req, err := http.NewRequest("GET", e.URI+endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
-	}
+// scrapeCollector runs a single sub-collector's scrape, recording its
+// duration and success as the bamboo_scrape_duration_seconds and
+// bamboo_scrape_collector_success metrics labeled by collector name.
+func (e *Exporter) scrapeCollector(ctx context.Context, c Collector) bool {
+	start := time.Now()
+	err := c.Scrape(ctx, e.client)
+	e.scrapeDuration.WithLabelValues(c.Name()).Observe(time.Since(start).Seconds())
 
-	req.Header.Set("Accept", "application/json")
-	req.SetBasicAuth(config.BambooUsername, config.BambooPassword)
-	resp, err := e.client.Do(req)
+	success := 1.0
 	if err != nil {
-		return nil, fmt.Errorf("error performing request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("unexpected status code: " + resp.Status)
+		e.logger.Error("Failed to scrape collector", "collector", c.Name(), "error", err)
+		e.failures.Inc()
+		success = 0
 	}
+	e.scrapeSuccess.WithLabelValues(c.Name()).Set(success)
 
-	return io.ReadAll(resp.Body)
-}
-
-func parseProjectAndName(planName string) (project, name string) {
-	parts := strings.SplitN(planName, " - ", 2)
-	if len(parts) >= 2 {
-		project = strings.TrimSpace(parts[0])
-		name = strings.TrimSpace(parts[1])
-	} else {
-		project = "Unknown"
-		name = strings.TrimSpace(planName)
-	}
-	return
+	return err == nil
 }
@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BambooQueue represents the build queue data fetched from the Bamboo API.
+type BambooQueue struct {
+	QueuedBuilds struct {
+		Size int64 `json:"size"`
+	} `json:"queuedBuilds"`
+}
+
+// queueCollector scrapes /rest/api/latest/queue and exposes the current
+// queue size and its change since the previous scrape.
+type queueCollector struct {
+	queue             prometheus.Gauge
+	queueChange       prometheus.Gauge
+	previousQueueSize int64
+}
+
+func newQueueCollector() *queueCollector {
+	return &queueCollector{
+		queue: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_size",
+			Help:      "Number of builds in the Bamboo queue.",
+		}),
+		queueChange: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_change",
+			Help:      "Change in the Bamboo build queue size since the last scrape.",
+		}),
+	}
+}
+
+func (c *queueCollector) Name() string { return "queue" }
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.queue.Describe(ch)
+	c.queueChange.Describe(ch)
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.queue.Collect(ch)
+	c.queueChange.Collect(ch)
+}
+
+// Scrape fetches and processes queue metrics from Bamboo.
+func (c *queueCollector) Scrape(ctx context.Context, client *bambooClient) error {
+	data, err := client.Get(ctx, "/rest/api/latest/queue")
+	if err != nil {
+		return fmt.Errorf("error fetching queue: %w", err)
+	}
+
+	var queue BambooQueue
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return fmt.Errorf("error unmarshaling queue: %w", err)
+	}
+
+	currentQueueSize := queue.QueuedBuilds.Size
+	c.queue.Set(float64(currentQueueSize))
+
+	// Calculate queue size change
+	change := currentQueueSize - c.previousQueueSize
+	c.queueChange.Set(float64(change))
+	c.previousQueueSize = currentQueueSize
+
+	return nil
+}
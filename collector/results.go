@@ -0,0 +1,355 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// planState is the on-disk record for a single plan, keyed by "project/name"
+// in resultsState.Plans. It carries enough to restore that plan's metrics
+// from scratch after a restart: Project/Name reconstruct the label values
+// without re-splitting the key, and the counts let build_success_total and
+// build_failure_total resume from their last known totals instead of
+// silently resetting to zero.
+type planState struct {
+	Project       string `json:"project"`
+	Name          string `json:"name"`
+	HighWatermark int64  `json:"high_watermark"`
+	SuccessCount  int64  `json:"success_count"`
+	FailureCount  int64  `json:"failure_count"`
+}
+
+// resultsState is the on-disk schema for --bamboo.results.state-file. It
+// survives restarts so build_success_total/build_failure_total keep correct
+// counter semantics instead of re-counting a plan's whole history on every
+// scrape, and so build_total/build_results_last_scrape_high_watermark don't
+// disappear from /metrics until the next new build for a plan.
+type resultsState struct {
+	Plans map[string]*planState `json:"plans"`
+}
+
+func loadResultsState(path string) (*resultsState, error) {
+	if path == "" {
+		return &resultsState{Plans: map[string]*planState{}}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &resultsState{Plans: map[string]*planState{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading results state file: %w", err)
+	}
+
+	var state resultsState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error unmarshaling results state file: %w", err)
+	}
+	if state.Plans == nil {
+		state.Plans = map[string]*planState{}
+	}
+	return &state, nil
+}
+
+// save writes state to path, via a temp file and rename so a crash mid-write
+// can't leave a truncated state file behind.
+func (s *resultsState) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling results state: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing results state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error renaming results state file into place: %w", err)
+	}
+	return nil
+}
+
+// resultsCollector scrapes /rest/api/latest/result and exposes per-project
+// build success/failure counts. It tracks the highest build number seen per
+// plan so that each build is counted once, instead of re-counting every build
+// on every scrape. Every scrape still reads every page of results; it does not
+// stop at the last build seen.
+type resultsCollector struct {
+	buildSuccess  *prometheus.CounterVec
+	buildFailure  *prometheus.CounterVec
+	buildCount    *prometheus.GaugeVec
+	highWatermark *prometheus.GaugeVec
+
+	statePath string
+	maxAge    time.Duration
+	logger    *slog.Logger
+
+	mu    sync.Mutex
+	state *resultsState
+}
+
+func newResultsCollector(statePath string, maxAge time.Duration, logger *slog.Logger) *resultsCollector {
+	state, err := loadResultsState(statePath)
+	if err != nil {
+		logger.Error("Failed to load build results state file, starting from scratch", "path", statePath, "error", err)
+		state = &resultsState{Plans: map[string]*planState{}}
+	}
+
+	c := &resultsCollector{
+		buildSuccess: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "build_success_total",
+			Help:      "Successful builds per project version",
+		}, []string{"project", "name"}),
+		buildFailure: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "build_failure_total",
+			Help:      "Failed builds per project version",
+		}, []string{"project", "name"}),
+		buildCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "build_total",
+			Help:      "Total builds executed per project version",
+		}, []string{"project", "name"}),
+		highWatermark: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "build_results_last_scrape_high_watermark",
+			Help:      "Highest Bamboo build number seen so far, per plan (counted, or skipped as older than max-age).",
+		}, []string{"project", "name"}),
+		statePath: statePath,
+		maxAge:    maxAge,
+		logger:    logger,
+		state:     state,
+	}
+
+	// Re-emit every persisted plan's metrics immediately, so a restart (or a
+	// scrape before the next new build lands) doesn't make these series
+	// disappear from /metrics while state.Plans still remembers them.
+	for _, p := range state.Plans {
+		labels := []string{p.Project, p.Name}
+		c.buildSuccess.WithLabelValues(labels...).Add(float64(p.SuccessCount))
+		c.buildFailure.WithLabelValues(labels...).Add(float64(p.FailureCount))
+		c.buildCount.WithLabelValues(labels...).Set(float64(p.HighWatermark))
+		c.highWatermark.WithLabelValues(labels...).Set(float64(p.HighWatermark))
+	}
+
+	return c
+}
+
+func (c *resultsCollector) Name() string { return "results" }
+
+func (c *resultsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.buildSuccess.Describe(ch)
+	c.buildFailure.Describe(ch)
+	c.buildCount.Describe(ch)
+	c.highWatermark.Describe(ch)
+}
+
+func (c *resultsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.buildSuccess.Collect(ch)
+	c.buildFailure.Collect(ch)
+	c.buildCount.Collect(ch)
+	c.highWatermark.Collect(ch)
+}
+
+// buildCompletedTimeLayout is the layout Bamboo actually sends in
+// buildCompletedTime: fractional seconds and a zone offset with no colon
+// (e.g. "2026-01-01T00:00:00.000+0000"), which time.RFC3339 cannot parse.
+const buildCompletedTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+func parseBuildCompletedTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(buildCompletedTimeLayout, s)
+}
+
+// planProgress tracks one plan's high watermark across a single Scrape call.
+// prev is snapshotted once, before any page is read, so that a newest-first
+// page ordering - which counts a plan's highest build before its lower ones
+// in the same scrape - doesn't have later builds in that same scrape
+// mistaken for already-counted just because they're below a watermark that
+// was only just raised this scrape.
+type planProgress struct {
+	prev    int64
+	maxSeen int64
+}
+
+// Scrape fetches build results from Bamboo and counts each build exactly
+// once, skipping any build number at or below the high watermark already
+// recorded for its plan from a *previous* scrape. Bamboo's
+// /rest/api/latest/result has no documented ordering guarantee, so
+// pagination always runs to the end of the result set rather than assuming a
+// page with nothing new means later pages are old too, so per-scrape cost is
+// O(every build Bamboo reports), not O(new builds only).
+func (c *resultsCollector) Scrape(ctx context.Context, client *bambooClient) error {
+	c.mu.Lock()
+	plans := make(map[string]*planState, len(c.state.Plans))
+	hadPriorWatermark := make(map[string]bool, len(c.state.Plans))
+	for key, p := range c.state.Plans {
+		cp := *p
+		plans[key] = &cp
+		hadPriorWatermark[key] = true
+	}
+	c.mu.Unlock()
+
+	// cutoff only bounds backfill for a plan Scrape is seeing for the first
+	// time (no prior high watermark): once a plan has one, every build above
+	// it is counted regardless of age, so the counters stay exact.
+	var cutoff time.Time
+	if c.maxAge > 0 {
+		cutoff = time.Now().Add(-c.maxAge)
+	}
+
+	progress := make(map[string]*planProgress)
+
+	currentIndex := 0
+	maxResult := 100
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("build results scrape canceled: %w", err)
+		}
+
+		// Bamboo's buildstate filter takes a single state, so we can't ask
+		// for "Successful,Failed" in one query; fetch everything and let the
+		// State switch below classify each build instead.
+		params := url.Values{
+			"start-index": []string{strconv.Itoa(currentIndex)},
+			"max-result":  []string{strconv.Itoa(maxResult)},
+			"expand":      []string{"results.result"},
+		}
+
+		data, err := client.Get(ctx, "/rest/api/latest/result?"+params.Encode())
+		if err != nil {
+			return fmt.Errorf("error fetching result: %w", err)
+		}
+
+		var response struct {
+			Results struct {
+				Size   int `json:"size"`
+				Result []struct {
+					Plan struct {
+						Name string `json:"name"`
+					} `json:"plan"`
+					BuildNumber        int64  `json:"buildNumber"`
+					State              string `json:"state"`
+					BuildCompletedTime string `json:"buildCompletedTime"`
+				} `json:"result"`
+			} `json:"results"`
+		}
+
+		if err := json.Unmarshal(data, &response); err != nil {
+			return fmt.Errorf("error unmarshaling results: %w", err)
+		}
+
+		if len(response.Results.Result) == 0 {
+			break
+		}
+
+		for _, r := range response.Results.Result {
+			project, name := parseProjectAndName(r.Plan.Name)
+			planKey := project + "/" + name
+
+			p, ok := plans[planKey]
+			if !ok {
+				p = &planState{Project: project, Name: name}
+				plans[planKey] = p
+			}
+
+			pr, ok := progress[planKey]
+			if !ok {
+				pr = &planProgress{prev: p.HighWatermark, maxSeen: p.HighWatermark}
+				progress[planKey] = pr
+			}
+
+			if r.BuildNumber <= pr.prev {
+				continue
+			}
+
+			if !hadPriorWatermark[planKey] && !cutoff.IsZero() {
+				completed, err := parseBuildCompletedTime(r.BuildCompletedTime)
+				if err != nil {
+					c.logger.Warn("Failed to parse build completed time, counting build anyway",
+						"plan", planKey, "build", r.BuildNumber, "value", r.BuildCompletedTime, "error", err)
+				} else if completed.Before(cutoff) {
+					// Raise the watermark past the skipped build too, so a
+					// later scrape doesn't count it once the plan has one.
+					if r.BuildNumber > pr.maxSeen {
+						pr.maxSeen = r.BuildNumber
+					}
+					continue
+				}
+			}
+
+			labels := []string{project, name}
+			switch r.State {
+			case "Successful":
+				c.buildSuccess.WithLabelValues(labels...).Inc()
+				p.SuccessCount++
+			default:
+				c.buildFailure.WithLabelValues(labels...).Inc()
+				p.FailureCount++
+			}
+
+			if r.BuildNumber > pr.maxSeen {
+				pr.maxSeen = r.BuildNumber
+			}
+		}
+
+		currentIndex += len(response.Results.Result)
+		if currentIndex >= response.Results.Size {
+			break
+		}
+	}
+
+	for planKey, pr := range progress {
+		if pr.maxSeen <= pr.prev {
+			continue
+		}
+		p := plans[planKey]
+		p.HighWatermark = pr.maxSeen
+		labels := []string{p.Project, p.Name}
+		c.buildCount.WithLabelValues(labels...).Set(float64(p.HighWatermark))
+		c.highWatermark.WithLabelValues(labels...).Set(float64(p.HighWatermark))
+	}
+
+	c.mu.Lock()
+	c.state.Plans = plans
+	state := c.state
+	c.mu.Unlock()
+
+	if err := state.save(c.statePath); err != nil {
+		return fmt.Errorf("error persisting results state: %w", err)
+	}
+
+	return nil
+}
+
+func parseProjectAndName(planName string) (project, name string) {
+	parts := strings.SplitN(planName, " - ", 2)
+	if len(parts) >= 2 {
+		project = strings.TrimSpace(parts[0])
+		name = strings.TrimSpace(parts[1])
+	} else {
+		project = "Unknown"
+		name = strings.TrimSpace(planName)
+	}
+	return
+}
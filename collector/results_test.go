@@ -0,0 +1,305 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"log/slog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// noAuth is a no-op Authenticator for tests that don't care about auth.
+type noAuth struct{}
+
+func (noAuth) Authenticate(req *http.Request) error { return nil }
+
+func newTestClient(uri string) *bambooClient {
+	return &bambooClient{
+		uri:  uri,
+		auth: noAuth{},
+		http: http.DefaultClient,
+		responseSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name: "test_client_response_size_bytes",
+		}),
+	}
+}
+
+type resultFixture struct {
+	planName      string
+	buildNumber   int64
+	state         string
+	completedTime string
+}
+
+// resultPage renders a single /rest/api/latest/result page containing
+// exactly the given builds, with Results.Size equal to total (so the caller
+// can simulate a result set bigger than one page).
+func resultPage(t *testing.T, builds []resultFixture, total int) []byte {
+	t.Helper()
+	return resultPageWithTimes(t, builds, total)
+}
+
+// resultPageWithTimes renders the page for resultPage: each fixture's
+// completedTime is sent as given, or as 2026-01-01T00:00:00.000+0000 when empty.
+func resultPageWithTimes(t *testing.T, builds []resultFixture, total int) []byte {
+	t.Helper()
+
+	type result struct {
+		Plan struct {
+			Name string `json:"name"`
+		} `json:"plan"`
+		BuildNumber        int64  `json:"buildNumber"`
+		State              string `json:"state"`
+		BuildCompletedTime string `json:"buildCompletedTime"`
+	}
+	var page struct {
+		Results struct {
+			Size   int      `json:"size"`
+			Result []result `json:"result"`
+		} `json:"results"`
+	}
+	page.Results.Size = total
+	for _, b := range builds {
+		var r result
+		r.Plan.Name = b.planName
+		r.BuildNumber = b.buildNumber
+		r.State = b.state
+		r.BuildCompletedTime = b.completedTime
+		if r.BuildCompletedTime == "" {
+			r.BuildCompletedTime = "2026-01-01T00:00:00.000+0000"
+		}
+		page.Results.Result = append(page.Results.Result, r)
+	}
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		t.Fatalf("marshaling fixture page: %v", err)
+	}
+	return data
+}
+
+func newResultsCollectorForTest(t *testing.T) *resultsCollector {
+	t.Helper()
+	return newResultsCollector("", 0, discardLogger())
+}
+
+func TestLoadResultsStateRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.json")
+
+	state, err := loadResultsState(path)
+	if err != nil {
+		t.Fatalf("loadResultsState on missing file: %v", err)
+	}
+	if len(state.Plans) != 0 {
+		t.Fatalf("expected empty state for missing file, got %+v", state.Plans)
+	}
+
+	state.Plans["PROJ/Plan"] = &planState{
+		Project:       "PROJ",
+		Name:          "Plan",
+		HighWatermark: 42,
+		SuccessCount:  3,
+		FailureCount:  1,
+	}
+	if err := state.save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	reloaded, err := loadResultsState(path)
+	if err != nil {
+		t.Fatalf("loadResultsState after save: %v", err)
+	}
+	p, ok := reloaded.Plans["PROJ/Plan"]
+	if !ok {
+		t.Fatalf("expected plan PROJ/Plan in reloaded state, got %+v", reloaded.Plans)
+	}
+	if p.HighWatermark != 42 || p.SuccessCount != 3 || p.FailureCount != 1 {
+		t.Fatalf("unexpected reloaded plan state: %+v", p)
+	}
+}
+
+func TestResultsCollectorScrapeNoNewBuild(t *testing.T) {
+	builds := []resultFixture{{planName: "PROJ - Plan", buildNumber: 1, state: "Successful"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPage(t, builds, len(builds)))
+	}))
+	defer server.Close()
+
+	c := newResultsCollectorForTest(t)
+	client := newTestClient(server.URL)
+
+	for i := 0; i < 2; i++ {
+		if err := c.Scrape(context.Background(), client); err != nil {
+			t.Fatalf("Scrape #%d: %v", i, err)
+		}
+	}
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Plan")); got != 1 {
+		t.Fatalf("build_success_total = %v, want 1 (build re-seen across scrapes shouldn't double count)", got)
+	}
+}
+
+func TestResultsCollectorScrapeNewBuildDelta(t *testing.T) {
+	c := newResultsCollectorForTest(t)
+
+	first := []resultFixture{{planName: "PROJ - Plan", buildNumber: 1, state: "Successful"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPage(t, first, len(first)))
+	}))
+	client := newTestClient(server.URL)
+	if err := c.Scrape(context.Background(), client); err != nil {
+		server.Close()
+		t.Fatalf("first Scrape: %v", err)
+	}
+	server.Close()
+
+	second := []resultFixture{
+		{planName: "PROJ - Plan", buildNumber: 1, state: "Successful"},
+		{planName: "PROJ - Plan", buildNumber: 2, state: "Failed"},
+	}
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPage(t, second, len(second)))
+	}))
+	defer server2.Close()
+	client.uri = server2.URL
+	if err := c.Scrape(context.Background(), client); err != nil {
+		t.Fatalf("second Scrape: %v", err)
+	}
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Plan")); got != 1 {
+		t.Fatalf("build_success_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.buildFailure.WithLabelValues("PROJ", "Plan")); got != 1 {
+		t.Fatalf("build_failure_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.highWatermark.WithLabelValues("PROJ", "Plan")); got != 2 {
+		t.Fatalf("high watermark = %v, want 2", got)
+	}
+}
+
+func TestResultsCollectorRestartFromState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "results.json")
+
+	state := &resultsState{Plans: map[string]*planState{
+		"PROJ/Plan": {Project: "PROJ", Name: "Plan", HighWatermark: 10, SuccessCount: 7, FailureCount: 2},
+	}}
+	if err := state.save(path); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	c := newResultsCollector(path, 0, discardLogger())
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Plan")); got != 7 {
+		t.Fatalf("build_success_total after restart = %v, want 7 (restored from state, before any scrape)", got)
+	}
+	if got := testutil.ToFloat64(c.buildFailure.WithLabelValues("PROJ", "Plan")); got != 2 {
+		t.Fatalf("build_failure_total after restart = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(c.highWatermark.WithLabelValues("PROJ", "Plan")); got != 10 {
+		t.Fatalf("high watermark after restart = %v, want 10", got)
+	}
+	if got := testutil.ToFloat64(c.buildCount.WithLabelValues("PROJ", "Plan")); got != 10 {
+		t.Fatalf("build_total after restart = %v, want 10", got)
+	}
+}
+
+func TestResultsCollectorScrapeNewestFirstFreshPlan(t *testing.T) {
+	// A brand-new plan, reported newest-first in a single scrape: both builds
+	// must be counted, since neither was seen in a prior scrape.
+	builds := []resultFixture{
+		{planName: "PROJ - Plan", buildNumber: 2, state: "Failed"},
+		{planName: "PROJ - Plan", buildNumber: 1, state: "Successful"},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPage(t, builds, len(builds)))
+	}))
+	defer server.Close()
+
+	c := newResultsCollectorForTest(t)
+	if err := c.Scrape(context.Background(), newTestClient(server.URL)); err != nil {
+		t.Fatalf("Scrape: %v", err)
+	}
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Plan")); got != 1 {
+		t.Fatalf("build_success_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.buildFailure.WithLabelValues("PROJ", "Plan")); got != 1 {
+		t.Fatalf("build_failure_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(c.highWatermark.WithLabelValues("PROJ", "Plan")); got != 2 {
+		t.Fatalf("high watermark = %v, want 2 (the max build number seen this scrape)", got)
+	}
+}
+
+func TestParseBuildCompletedTime(t *testing.T) {
+	got, err := parseBuildCompletedTime("2026-01-01T00:00:00.000+0000")
+	if err != nil {
+		t.Fatalf("parseBuildCompletedTime: %v", err)
+	}
+	if got.Year() != 2026 {
+		t.Fatalf("parsed time = %v, want year 2026", got)
+	}
+}
+
+func TestResultsCollectorScrapeMaxAgeBackfillsOnlyFreshPlans(t *testing.T) {
+	old := []resultFixture{{planName: "PROJ - Old", buildNumber: 1, state: "Successful", completedTime: "2020-01-01T00:00:00.000+0000"}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPageWithTimes(t, old, len(old)))
+	}))
+	c := newResultsCollector("", time.Hour, discardLogger())
+	if err := c.Scrape(context.Background(), newTestClient(server.URL)); err != nil {
+		server.Close()
+		t.Fatalf("Scrape: %v", err)
+	}
+	server.Close()
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Old")); got != 0 {
+		t.Fatalf("build_success_total for a stale first-seen build = %v, want 0 (older than --bamboo.results.max-age)", got)
+	}
+
+	// A second scrape reports a new build for the same plan that is also older
+	// than the cutoff; the cutoff must not suppress it, since the plan already
+	// has a high watermark (build 1, skipped) from the first scrape.
+	more := []resultFixture{{planName: "PROJ - Old", buildNumber: 2, state: "Successful", completedTime: "2020-01-02T00:00:00.000+0000"}}
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(resultPageWithTimes(t, more, len(more)))
+	}))
+	defer server2.Close()
+	if err := c.Scrape(context.Background(), newTestClient(server2.URL)); err != nil {
+		t.Fatalf("second Scrape: %v", err)
+	}
+
+	if got := testutil.ToFloat64(c.buildSuccess.WithLabelValues("PROJ", "Old")); got != 1 {
+		t.Fatalf("build_success_total after a second, older-but-new build = %v, want 1 (max-age only gates a plan's first sighting)", got)
+	}
+}
+
+func TestParseProjectAndName(t *testing.T) {
+	cases := []struct {
+		in, project, name string
+	}{
+		{"PROJ - Plan", "PROJ", "Plan"},
+		{"PROJ - Plan - Stage", "PROJ", "Plan - Stage"},
+		{"NoSeparator", "Unknown", "NoSeparator"},
+	}
+	for _, tc := range cases {
+		project, name := parseProjectAndName(tc.in)
+		if project != tc.project || name != tc.name {
+			t.Errorf("parseProjectAndName(%q) = (%q, %q), want (%q, %q)", tc.in, project, name, tc.project, tc.name)
+		}
+	}
+}
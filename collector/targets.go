@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TargetConfig describes a single Bamboo instance that the exporter can probe.
+type TargetConfig struct {
+	Name     string `yaml:"name"`
+	URI      string `yaml:"uri"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+// Authenticator builds the Authenticator described by this target's
+// credential fields, or nil if none are set (callers should fall back to
+// the exporter's global --bamboo.auth-type authenticator).
+func (t TargetConfig) Authenticator() Authenticator {
+	switch {
+	case t.Token != "":
+		return &TokenAuthenticator{Token: t.Token}
+	case t.Username != "":
+		return &BasicAuthenticator{Username: t.Username, Password: t.Password}
+	default:
+		return nil
+	}
+}
+
+// TargetsConfig is the top-level schema for the multi-target config file, which
+// lists the Bamboo instances that can be probed via /probe?target=<uri>.
+type TargetsConfig struct {
+	Targets []TargetConfig `yaml:"targets"`
+}
+
+// LoadTargetsConfig reads and parses a multi-target config file from disk.
+func LoadTargetsConfig(path string) (*TargetsConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading targets config file: %w", err)
+	}
+
+	var cfg TargetsConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshaling targets config file: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// Lookup returns the TargetConfig whose URI matches uri, if one is configured.
+func (c *TargetsConfig) Lookup(uri string) (TargetConfig, bool) {
+	for _, t := range c.Targets {
+		if t.URI == uri {
+			return t, true
+		}
+	}
+	return TargetConfig{}, false
+}